@@ -0,0 +1,896 @@
+// Package csi is a client library for talking to CSI plugins over gRPC, as
+// documented in the CSI spec: https://github.com/container-storage-interface/spec.
+// It is not itself wired up to any Nomad CLI command, HTTP endpoint, or RPC
+// - it's the primitive that the controller/client CSI volume managers call
+// into.
+package csi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	csipbv1 "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CSIPlugin implements a set of interfaces that are used to communicate with
+// CSI plugins over gRPC, as documented in the CSI spec:
+// https://github.com/container-storage-interface/spec
+type CSIPlugin interface {
+	PluginProbe(ctx context.Context) (bool, error)
+	PluginGetInfo(ctx context.Context) (string, error)
+	PluginGetCapabilities(ctx context.Context) (*PluginCapabilitySet, error)
+
+	// ControllerGetCapabilities is used to discover the supported
+	// capabilities of the CSI Controller Plugin.
+	ControllerGetCapabilities(ctx context.Context) (*ControllerCapabilitySet, error)
+
+	// CreateVolume provisions a new volume on behalf of the CO.
+	CreateVolume(ctx context.Context, req *CreateVolumeRequest) (*CreateVolumeResponse, error)
+
+	// DeleteVolume deprovisions a volume previously created with
+	// CreateVolume.
+	DeleteVolume(ctx context.Context, volumeID string) error
+
+	// ControllerPublishVolume is used to attach a remote volume to a
+	// cluster node.
+	ControllerPublishVolume(ctx context.Context, req *ControllerPublishVolumeRequest) (*ControllerPublishVolumeResponse, error)
+
+	// ControllerUnpublishVolume is used to detach a remote volume from a
+	// cluster node, undoing the work performed by ControllerPublishVolume.
+	ControllerUnpublishVolume(ctx context.Context, volumeID, nodeID string) error
+
+	// ControllerExpandVolume is used to expand a volume that has already
+	// been provisioned, growing it to the requested capacity range
+	// without requiring the volume to be recreated.
+	ControllerExpandVolume(ctx context.Context, req *ControllerExpandVolumeRequest) (*ControllerExpandVolumeResponse, error)
+
+	// NodeGetCapabilities is used to return the supported capabilities of
+	// the CSI Node Plugin.
+	NodeGetCapabilities(ctx context.Context) (*NodeCapabilitySet, error)
+
+	// NodeStageVolume is used when a plugin has the STAGE_UNSTAGE_VOLUME
+	// capability to prepare a volume for usage on a host.
+	NodeStageVolume(ctx context.Context, volumeID string, publishContext map[string]string, stagingTargetPath string, capability *VolumeCapability) error
+
+	// NodeUnstageVolume is used when a plugin has the STAGE_UNSTAGE_VOLUME
+	// capability to undo the work performed by NodeStageVolume.
+	NodeUnstageVolume(ctx context.Context, volumeID string, stagingTargetPath string) error
+
+	// NodePublishVolume makes a staged (or, for plugins without the
+	// STAGE_UNSTAGE_VOLUME capability, raw) volume available at
+	// targetPath for a task to use.
+	NodePublishVolume(ctx context.Context, req *NodePublishVolumeRequest) error
+
+	// NodeUnpublishVolume undoes the work performed by NodePublishVolume.
+	NodeUnpublishVolume(ctx context.Context, volumeID, targetPath string) error
+
+	// NodeGetVolumeStats is used when a plugin has the GET_VOLUME_STATS
+	// capability to report capacity usage and health for a volume that's
+	// currently staged or published at volumePath.
+	NodeGetVolumeStats(ctx context.Context, volumeID, volumePath string) (*VolumeStats, error)
+
+	// NodeExpandVolume is used when a plugin has the EXPAND_VOLUME node
+	// capability to grow a volume that is already staged or published on
+	// the host, without requiring it to be unmounted first.
+	NodeExpandVolume(ctx context.Context, req *NodeExpandVolumeRequest) (*NodeExpandVolumeResponse, error)
+
+	// Subscribe returns a channel of PluginEvents describing this
+	// plugin's lifecycle transitions, so that callers can observe state
+	// changes (registration, readiness, publish/stage activity) without
+	// polling.
+	Subscribe(ctx context.Context) <-chan PluginEvent
+
+	// ProbeUntilReady calls Probe on the given interval until the plugin
+	// reports Ready=true, ctx expires or timeout elapses, or Probe returns
+	// a gRPC status other than Unavailable or DeadlineExceeded.
+	ProbeUntilReady(ctx context.Context, interval, timeout time.Duration) error
+
+	// Shutdown the client and ensure any connections are cleaned up.
+	Close() error
+}
+
+// client is the default implementation of the CSIPlugin interface. It
+// communicates with the gRPC endpoints exposed by CSI plugins.
+type client struct {
+	conn   *grpc.ClientConn
+	logger hclog.Logger
+
+	// pluginID identifies the plugin this client talks to in emitted
+	// PluginEvents.
+	pluginID string
+
+	identityClient   csipbv1.IdentityClient
+	controllerClient csipbv1.ControllerClient
+	nodeClient       csipbv1.NodeClient
+
+	// readyMu guards wasReady, which lets PluginProbe emit EventPluginReady
+	// only on the not-ready -> ready transition instead of on every probe.
+	readyMu  sync.Mutex
+	wasReady bool
+
+	eventer
+}
+
+// NewClient returns a new CSIPlugin backed by a gRPC connection to the
+// provided address. pluginID is used to tag the PluginEvents this client
+// emits.
+func NewClient(addr, pluginID string, logger hclog.Logger) (CSIPlugin, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	conn, err := newGRPCConn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{
+		conn:             conn,
+		logger:           logger,
+		pluginID:         pluginID,
+		identityClient:   csipbv1.NewIdentityClient(conn),
+		controllerClient: csipbv1.NewControllerClient(conn),
+		nodeClient:       csipbv1.NewNodeClient(conn),
+	}
+	c.emitAndReplay(PluginEvent{Type: EventPluginRegistered, PluginID: pluginID, Timestamp: time.Now()})
+	return c, nil
+}
+
+func (c *client) Close() error {
+	c.emit(PluginEvent{Type: EventPluginUnregistered, PluginID: c.pluginID, Timestamp: time.Now()})
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// NewTestClient constructs a CSIPlugin directly from gRPC client
+// implementations rather than dialing a real connection. It's exported so
+// that tests in other packages (e.g. plugins/csi/sanity) can exercise this
+// package's RPC marshaling and local request validation against the fakes
+// in plugins/csi/testing, instead of reimplementing that validation
+// themselves.
+func NewTestClient(identity csipbv1.IdentityClient, controller csipbv1.ControllerClient, node csipbv1.NodeClient) CSIPlugin {
+	return &client{
+		identityClient:   identity,
+		controllerClient: controller,
+		nodeClient:       node,
+		logger:           hclog.NewNullLogger(),
+	}
+}
+
+func (c *client) PluginProbe(ctx context.Context) (bool, error) {
+	resp, err := c.identityClient.Probe(ctx, &csipbv1.ProbeRequest{})
+	if err != nil {
+		c.emit(PluginEvent{
+			Type:      EventPluginProbeFailed,
+			PluginID:  c.pluginID,
+			Code:      status.Code(err),
+			Err:       err,
+			Timestamp: time.Now(),
+		})
+		return false, err
+	}
+
+	wrapper := resp.GetReady()
+	// When a SP does not return a ready value, a CO MAY treat this as
+	// ready. We do so because example plugins rely on this behaviour. We
+	// may re-evaluate this decision in the future.
+	ready := wrapper == nil || wrapper.GetValue()
+
+	c.readyMu.Lock()
+	transitioned := ready && !c.wasReady
+	c.wasReady = ready
+	c.readyMu.Unlock()
+	if transitioned {
+		c.emit(PluginEvent{Type: EventPluginReady, PluginID: c.pluginID, Timestamp: time.Now()})
+	}
+
+	return ready, nil
+}
+
+func (c *client) PluginGetInfo(ctx context.Context) (string, error) {
+	resp, err := c.identityClient.GetPluginInfo(ctx, &csipbv1.GetPluginInfoRequest{})
+	if err != nil {
+		return "", err
+	}
+
+	name := resp.GetName()
+	if name == "" {
+		return "", fmt.Errorf("PluginGetInfo: plugin returned empty name field")
+	}
+
+	return name, nil
+}
+
+// PluginCapabilitySet is a helper for querying plugin capabilities.
+type PluginCapabilitySet struct {
+	hasControllerService bool
+	hasTopologies        bool
+}
+
+func (p *PluginCapabilitySet) HasControllerService() bool {
+	return p.hasControllerService
+}
+
+func (p *PluginCapabilitySet) HasTopologies() bool {
+	return p.hasTopologies
+}
+
+func (c *client) PluginGetCapabilities(ctx context.Context) (*PluginCapabilitySet, error) {
+	resp, err := c.identityClient.GetPluginCapabilities(ctx, &csipbv1.GetPluginCapabilitiesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &PluginCapabilitySet{}
+	for _, cap := range resp.GetCapabilities() {
+		if svc := cap.GetService(); svc != nil {
+			switch svc.Type {
+			case csipbv1.PluginCapability_Service_CONTROLLER_SERVICE:
+				cs.hasControllerService = true
+			case csipbv1.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS:
+				cs.hasTopologies = true
+			default:
+				continue
+			}
+		}
+	}
+
+	return cs, nil
+}
+
+// ControllerCapabilitySet is a helper for querying controller plugin
+// capabilities.
+type ControllerCapabilitySet struct {
+	HasListVolumes               bool
+	HasListVolumesPublishedNodes bool
+	HasPublishUnpublishVolume    bool
+	HasPublishReadonly           bool
+	HasExpandVolume              bool
+}
+
+func newControllerCapabilitySet(resp *csipbv1.ControllerGetCapabilitiesResponse) *ControllerCapabilitySet {
+	cs := &ControllerCapabilitySet{}
+	for _, cap := range resp.GetCapabilities() {
+		rpc := cap.GetRpc()
+		if rpc == nil {
+			continue
+		}
+
+		switch rpc.Type {
+		case csipbv1.ControllerServiceCapability_RPC_LIST_VOLUMES:
+			cs.HasListVolumes = true
+		case csipbv1.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES:
+			cs.HasListVolumesPublishedNodes = true
+		case csipbv1.ControllerServiceCapability_RPC_PUBLISH_READONLY:
+			cs.HasPublishReadonly = true
+		case csipbv1.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME:
+			cs.HasPublishUnpublishVolume = true
+		case csipbv1.ControllerServiceCapability_RPC_EXPAND_VOLUME:
+			cs.HasExpandVolume = true
+		default:
+			continue
+		}
+	}
+
+	return cs
+}
+
+func (c *client) ControllerGetCapabilities(ctx context.Context) (*ControllerCapabilitySet, error) {
+	resp, err := c.controllerClient.ControllerGetCapabilities(ctx, &csipbv1.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return newControllerCapabilitySet(resp), nil
+}
+
+// NodeCapabilitySet is a helper for querying node plugin capabilities.
+type NodeCapabilitySet struct {
+	HasStageUnstageVolume bool
+	HasExpandVolume       bool
+	HasGetVolumeStats     bool
+	HasVolumeCondition    bool
+}
+
+func newNodeCapabilitySet(resp *csipbv1.NodeGetCapabilitiesResponse) *NodeCapabilitySet {
+	cs := &NodeCapabilitySet{}
+	for _, cap := range resp.GetCapabilities() {
+		rpc := cap.GetRpc()
+		if rpc == nil {
+			continue
+		}
+
+		switch rpc.Type {
+		case csipbv1.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME:
+			cs.HasStageUnstageVolume = true
+		case csipbv1.NodeServiceCapability_RPC_EXPAND_VOLUME:
+			cs.HasExpandVolume = true
+		case csipbv1.NodeServiceCapability_RPC_GET_VOLUME_STATS:
+			cs.HasGetVolumeStats = true
+		case csipbv1.NodeServiceCapability_RPC_VOLUME_CONDITION:
+			cs.HasVolumeCondition = true
+		default:
+			continue
+		}
+	}
+
+	return cs
+}
+
+func (c *client) NodeGetCapabilities(ctx context.Context) (*NodeCapabilitySet, error) {
+	resp, err := c.nodeClient.NodeGetCapabilities(ctx, &csipbv1.NodeGetCapabilitiesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return newNodeCapabilitySet(resp), nil
+}
+
+// VolumeCapability describes how a CO intends to use a volume.
+type VolumeCapability struct {
+	AccessType string
+	AccessMode string
+}
+
+// Access types recognized by VolumeCapability.AccessType, mirroring the
+// CSI spec's oneof VolumeCapability.access_type.
+const (
+	VolumeAccessTypeBlock = "block-device"
+	VolumeAccessTypeMount = "file-system"
+)
+
+// Access modes recognized by VolumeCapability.AccessMode, mirroring the
+// CSI spec's VolumeCapability_AccessMode enum.
+const (
+	VolumeAccessModeSingleNodeWriter      = "single-node-writer"
+	VolumeAccessModeSingleNodeReaderOnly  = "single-node-reader-only"
+	VolumeAccessModeMultiNodeReaderOnly   = "multi-node-reader-only"
+	VolumeAccessModeMultiNodeSingleWriter = "multi-node-single-writer"
+	VolumeAccessModeMultiNodeMultiWriter  = "multi-node-multi-writer"
+)
+
+// toCSIRequest converts a VolumeCapability into the wire type, so that the
+// access mode and type Nomad negotiated actually reach the plugin instead
+// of being silently dropped. A nil capability still produces one, since
+// volume_capability is a required field on the RPCs that take it; it
+// defaults to the common single-node-writer/file-system case.
+func (v *VolumeCapability) toCSIRequest() *csipbv1.VolumeCapability {
+	accessType := VolumeAccessTypeMount
+	accessMode := VolumeAccessModeSingleNodeWriter
+	if v != nil {
+		if v.AccessType != "" {
+			accessType = v.AccessType
+		}
+		if v.AccessMode != "" {
+			accessMode = v.AccessMode
+		}
+	}
+
+	out := &csipbv1.VolumeCapability{
+		AccessMode: &csipbv1.VolumeCapability_AccessMode{
+			Mode: volumeAccessModeToCSI(accessMode),
+		},
+	}
+	if accessType == VolumeAccessTypeBlock {
+		out.AccessType = &csipbv1.VolumeCapability_Block{
+			Block: &csipbv1.VolumeCapability_BlockVolume{},
+		}
+	} else {
+		out.AccessType = &csipbv1.VolumeCapability_Mount{
+			Mount: &csipbv1.VolumeCapability_MountVolume{},
+		}
+	}
+
+	return out
+}
+
+func volumeAccessModeToCSI(mode string) csipbv1.VolumeCapability_AccessMode_Mode {
+	switch mode {
+	case VolumeAccessModeSingleNodeReaderOnly:
+		return csipbv1.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+	case VolumeAccessModeMultiNodeReaderOnly:
+		return csipbv1.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+	case VolumeAccessModeMultiNodeSingleWriter:
+		return csipbv1.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER
+	case VolumeAccessModeMultiNodeMultiWriter:
+		return csipbv1.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+	default:
+		// VolumeAccessModeSingleNodeWriter and any unrecognized value both
+		// fall back here; single-node-writer is the common case and a
+		// safe default.
+		return csipbv1.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+	}
+}
+
+// CreateVolumeRequest is the set of arguments needed to provision a new
+// volume via a Controller plugin.
+type CreateVolumeRequest struct {
+	Name               string
+	CapacityRange      *CapacityRange
+	VolumeCapabilities []*VolumeCapability
+	Parameters         map[string]string
+	Secrets            map[string]string
+}
+
+// CreateVolumeResponse is the response returned by the CreateVolume RPC.
+type CreateVolumeResponse struct {
+	VolumeID      string
+	CapacityBytes int64
+	VolumeContext map[string]string
+}
+
+func (c *client) CreateVolume(ctx context.Context, req *CreateVolumeRequest) (*CreateVolumeResponse, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("CreateVolume: missing Name")
+	}
+
+	creq := &csipbv1.CreateVolumeRequest{
+		Name:       req.Name,
+		Parameters: req.Parameters,
+		Secrets:    req.Secrets,
+	}
+	for _, vc := range req.VolumeCapabilities {
+		creq.VolumeCapabilities = append(creq.VolumeCapabilities, vc.toCSIRequest())
+	}
+	if req.CapacityRange != nil {
+		creq.CapacityRange = &csipbv1.CapacityRange{
+			RequiredBytes: req.CapacityRange.RequiredBytes,
+			LimitBytes:    req.CapacityRange.LimitBytes,
+		}
+	}
+
+	resp, err := c.controllerClient.CreateVolume(ctx, creq)
+	if err != nil {
+		return nil, err
+	}
+
+	vol := resp.GetVolume()
+	return &CreateVolumeResponse{
+		VolumeID:      vol.GetVolumeId(),
+		CapacityBytes: vol.GetCapacityBytes(),
+		VolumeContext: vol.GetVolumeContext(),
+	}, nil
+}
+
+func (c *client) DeleteVolume(ctx context.Context, volumeID string) error {
+	if volumeID == "" {
+		return fmt.Errorf("DeleteVolume: missing VolumeID")
+	}
+
+	_, err := c.controllerClient.DeleteVolume(ctx, &csipbv1.DeleteVolumeRequest{VolumeId: volumeID})
+	return err
+}
+
+// ControllerPublishVolumeRequest is the set of arguments needed to publish
+// a volume to a given cluster node via a Controller plugin.
+type ControllerPublishVolumeRequest struct {
+	VolumeID         string
+	NodeID           string
+	VolumeCapability *VolumeCapability
+	Readonly         bool
+	Secrets          map[string]string
+	VolumeContext    map[string]string
+}
+
+// ControllerPublishVolumeResponse is the response returned by the
+// ControllerPublishVolume RPC.
+type ControllerPublishVolumeResponse struct {
+	PublishContext map[string]string
+}
+
+func (c *client) ControllerPublishVolume(ctx context.Context, req *ControllerPublishVolumeRequest) (*ControllerPublishVolumeResponse, error) {
+	if req.VolumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "ControllerPublishVolume: missing VolumeID")
+	}
+	if req.NodeID == "" {
+		return nil, fmt.Errorf("ControllerPublishVolume: missing NodeID")
+	}
+
+	start := time.Now()
+	c.emit(PluginEvent{
+		Type:      EventControllerPublishStart,
+		PluginID:  c.pluginID,
+		VolumeID:  req.VolumeID,
+		NodeID:    req.NodeID,
+		Timestamp: start,
+	})
+
+	resp, err := c.controllerClient.ControllerPublishVolume(ctx, &csipbv1.ControllerPublishVolumeRequest{
+		VolumeId:         req.VolumeID,
+		NodeId:           req.NodeID,
+		Readonly:         req.Readonly,
+		Secrets:          req.Secrets,
+		VolumeContext:    req.VolumeContext,
+		VolumeCapability: req.VolumeCapability.toCSIRequest(),
+	})
+	if err != nil {
+		c.emit(PluginEvent{
+			Type:      EventControllerPublishFail,
+			PluginID:  c.pluginID,
+			VolumeID:  req.VolumeID,
+			NodeID:    req.NodeID,
+			Duration:  time.Since(start),
+			Code:      status.Code(err),
+			Err:       err,
+			Timestamp: time.Now(),
+		})
+		return nil, err
+	}
+
+	c.emit(PluginEvent{
+		Type:      EventControllerPublishOK,
+		PluginID:  c.pluginID,
+		VolumeID:  req.VolumeID,
+		NodeID:    req.NodeID,
+		Duration:  time.Since(start),
+		Timestamp: time.Now(),
+	})
+
+	return &ControllerPublishVolumeResponse{
+		PublishContext: resp.GetPublishContext(),
+	}, nil
+}
+
+func (c *client) ControllerUnpublishVolume(ctx context.Context, volumeID, nodeID string) error {
+	if volumeID == "" {
+		return fmt.Errorf("ControllerUnpublishVolume: missing VolumeID")
+	}
+
+	_, err := c.controllerClient.ControllerUnpublishVolume(ctx, &csipbv1.ControllerUnpublishVolumeRequest{
+		VolumeId: volumeID,
+		NodeId:   nodeID,
+	})
+	return err
+}
+
+// ControllerExpandVolumeRequest is the set of arguments needed to grow a
+// volume that has already been provisioned, per CSI spec v1.5's
+// ControllerExpandVolume RPC.
+type ControllerExpandVolumeRequest struct {
+	VolumeID         string
+	CapacityRange    *CapacityRange
+	Secrets          map[string]string
+	VolumeCapability *VolumeCapability
+}
+
+// ControllerExpandVolumeResponse is the response returned by the
+// ControllerExpandVolume RPC.
+type ControllerExpandVolumeResponse struct {
+	CapacityBytes         int64
+	NodeExpansionRequired bool
+}
+
+// CapacityRange describes the minimum and maximum size a volume should be
+// expanded to or created with.
+type CapacityRange struct {
+	RequiredBytes int64
+	LimitBytes    int64
+}
+
+func (c *client) ControllerExpandVolume(ctx context.Context, req *ControllerExpandVolumeRequest) (*ControllerExpandVolumeResponse, error) {
+	if req.VolumeID == "" {
+		return nil, fmt.Errorf("ControllerExpandVolume: missing VolumeID")
+	}
+
+	creq := &csipbv1.ControllerExpandVolumeRequest{
+		VolumeId:         req.VolumeID,
+		Secrets:          req.Secrets,
+		VolumeCapability: req.VolumeCapability.toCSIRequest(),
+	}
+	if req.CapacityRange != nil {
+		creq.CapacityRange = &csipbv1.CapacityRange{
+			RequiredBytes: req.CapacityRange.RequiredBytes,
+			LimitBytes:    req.CapacityRange.LimitBytes,
+		}
+	}
+
+	resp, err := c.controllerClient.ControllerExpandVolume(ctx, creq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ControllerExpandVolumeResponse{
+		CapacityBytes:         resp.GetCapacityBytes(),
+		NodeExpansionRequired: resp.GetNodeExpansionRequired(),
+	}, nil
+}
+
+func (c *client) NodeStageVolume(ctx context.Context, volumeID string, publishContext map[string]string, stagingTargetPath string, capability *VolumeCapability) error {
+	if volumeID == "" {
+		return fmt.Errorf("NodeStageVolume: missing VolumeID")
+	}
+	if stagingTargetPath == "" {
+		return fmt.Errorf("NodeStageVolume: missing StagingTargetPath")
+	}
+
+	start := time.Now()
+	c.emit(PluginEvent{Type: EventNodeStageStart, PluginID: c.pluginID, VolumeID: volumeID, Timestamp: start})
+
+	_, err := c.nodeClient.NodeStageVolume(ctx, &csipbv1.NodeStageVolumeRequest{
+		VolumeId:          volumeID,
+		PublishContext:    publishContext,
+		StagingTargetPath: stagingTargetPath,
+		VolumeCapability:  capability.toCSIRequest(),
+	})
+	if err != nil {
+		c.emit(PluginEvent{
+			Type:      EventNodeStageFail,
+			PluginID:  c.pluginID,
+			VolumeID:  volumeID,
+			Duration:  time.Since(start),
+			Code:      status.Code(err),
+			Err:       err,
+			Timestamp: time.Now(),
+		})
+		return err
+	}
+
+	c.emit(PluginEvent{
+		Type:      EventNodeStageOK,
+		PluginID:  c.pluginID,
+		VolumeID:  volumeID,
+		Duration:  time.Since(start),
+		Timestamp: time.Now(),
+	})
+	return nil
+}
+
+func (c *client) NodeUnstageVolume(ctx context.Context, volumeID string, stagingTargetPath string) error {
+	if volumeID == "" {
+		return fmt.Errorf("NodeUnstageVolume: missing VolumeID")
+	}
+
+	start := time.Now()
+	c.emit(PluginEvent{Type: EventNodeStageStart, PluginID: c.pluginID, VolumeID: volumeID, Timestamp: start})
+
+	_, err := c.nodeClient.NodeUnstageVolume(ctx, &csipbv1.NodeUnstageVolumeRequest{
+		VolumeId:          volumeID,
+		StagingTargetPath: stagingTargetPath,
+	})
+	if err != nil {
+		c.emit(PluginEvent{
+			Type:      EventNodeStageFail,
+			PluginID:  c.pluginID,
+			VolumeID:  volumeID,
+			Duration:  time.Since(start),
+			Code:      status.Code(err),
+			Err:       err,
+			Timestamp: time.Now(),
+		})
+		return err
+	}
+
+	c.emit(PluginEvent{
+		Type:      EventNodeStageOK,
+		PluginID:  c.pluginID,
+		VolumeID:  volumeID,
+		Duration:  time.Since(start),
+		Timestamp: time.Now(),
+	})
+	return nil
+}
+
+// NodePublishVolumeRequest is the set of arguments needed to make a volume
+// available at a target path for a task to use.
+type NodePublishVolumeRequest struct {
+	VolumeID          string
+	PublishContext    map[string]string
+	StagingTargetPath string
+	TargetPath        string
+	Capability        *VolumeCapability
+	Readonly          bool
+}
+
+func (c *client) NodePublishVolume(ctx context.Context, req *NodePublishVolumeRequest) error {
+	if req.VolumeID == "" {
+		return fmt.Errorf("NodePublishVolume: missing VolumeID")
+	}
+	if req.TargetPath == "" {
+		return fmt.Errorf("NodePublishVolume: missing TargetPath")
+	}
+
+	_, err := c.nodeClient.NodePublishVolume(ctx, &csipbv1.NodePublishVolumeRequest{
+		VolumeId:          req.VolumeID,
+		PublishContext:    req.PublishContext,
+		StagingTargetPath: req.StagingTargetPath,
+		TargetPath:        req.TargetPath,
+		Readonly:          req.Readonly,
+		VolumeCapability:  req.Capability.toCSIRequest(),
+	})
+	return err
+}
+
+func (c *client) NodeUnpublishVolume(ctx context.Context, volumeID, targetPath string) error {
+	if volumeID == "" {
+		return fmt.Errorf("NodeUnpublishVolume: missing VolumeID")
+	}
+
+	_, err := c.nodeClient.NodeUnpublishVolume(ctx, &csipbv1.NodeUnpublishVolumeRequest{
+		VolumeId:   volumeID,
+		TargetPath: targetPath,
+	})
+	return err
+}
+
+// VolumeUsage reports capacity usage for a single unit (bytes or inodes)
+// of a volume.
+type VolumeUsage struct {
+	Used      int64
+	Available int64
+	Total     int64
+}
+
+// VolumeCondition reports the health of a volume as observed by the node
+// plugin.
+type VolumeCondition struct {
+	Abnormal bool
+	Message  string
+}
+
+// VolumeStats is the response returned by NodeGetVolumeStats.
+type VolumeStats struct {
+	Bytes     *VolumeUsage
+	Inodes    *VolumeUsage
+	Condition *VolumeCondition
+}
+
+func (c *client) NodeGetVolumeStats(ctx context.Context, volumeID, volumePath string) (*VolumeStats, error) {
+	if volumeID == "" {
+		return nil, fmt.Errorf("NodeGetVolumeStats: missing VolumeID")
+	}
+	if volumePath == "" {
+		return nil, fmt.Errorf("NodeGetVolumeStats: missing VolumePath")
+	}
+
+	resp, err := c.nodeClient.NodeGetVolumeStats(ctx, &csipbv1.NodeGetVolumeStatsRequest{
+		VolumeId:   volumeID,
+		VolumePath: volumePath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &VolumeStats{}
+	for _, usage := range resp.GetUsage() {
+		u := &VolumeUsage{
+			Used:      usage.GetUsed(),
+			Available: usage.GetAvailable(),
+			Total:     usage.GetTotal(),
+		}
+		switch usage.GetUnit() {
+		case csipbv1.VolumeUsage_BYTES:
+			stats.Bytes = u
+		case csipbv1.VolumeUsage_INODES:
+			stats.Inodes = u
+		}
+	}
+
+	if cond := resp.GetVolumeCondition(); cond != nil {
+		stats.Condition = &VolumeCondition{
+			Abnormal: cond.GetAbnormal(),
+			Message:  cond.GetMessage(),
+		}
+	}
+
+	return stats, nil
+}
+
+// NodeExpandVolumeRequest is the set of arguments needed to grow a volume
+// that is already staged or published on a node, per CSI spec v1.5's
+// NodeExpandVolume RPC.
+type NodeExpandVolumeRequest struct {
+	VolumeID      string
+	VolumePath    string
+	StagingPath   string
+	CapacityRange *CapacityRange
+	Capability    *VolumeCapability
+}
+
+// NodeExpandVolumeResponse is the response returned by the
+// NodeExpandVolume RPC.
+type NodeExpandVolumeResponse struct {
+	CapacityBytes int64
+}
+
+func (c *client) NodeExpandVolume(ctx context.Context, req *NodeExpandVolumeRequest) (*NodeExpandVolumeResponse, error) {
+	if req.VolumeID == "" {
+		return nil, fmt.Errorf("NodeExpandVolume: missing VolumeID")
+	}
+	if req.VolumePath == "" {
+		return nil, fmt.Errorf("NodeExpandVolume: missing VolumePath")
+	}
+
+	nreq := &csipbv1.NodeExpandVolumeRequest{
+		VolumeId:          req.VolumeID,
+		VolumePath:        req.VolumePath,
+		StagingTargetPath: req.StagingPath,
+		VolumeCapability:  req.Capability.toCSIRequest(),
+	}
+	if req.CapacityRange != nil {
+		nreq.CapacityRange = &csipbv1.CapacityRange{
+			RequiredBytes: req.CapacityRange.RequiredBytes,
+			LimitBytes:    req.CapacityRange.LimitBytes,
+		}
+	}
+
+	resp, err := c.nodeClient.NodeExpandVolume(ctx, nreq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodeExpandVolumeResponse{
+		CapacityBytes: resp.GetCapacityBytes(),
+	}, nil
+}
+
+// defaultProbeInterval is the polling interval ProbeUntilReady falls back
+// to when the caller does not specify one.
+const defaultProbeInterval = 1 * time.Second
+
+// probeErrLogInterval throttles how often connection errors are logged
+// while waiting for a plugin to become ready, so a flapping or slow-to-
+// start plugin doesn't spam the log.
+const probeErrLogInterval = 10 * time.Second
+
+// ProbeUntilReady polls Probe on the given interval until the plugin
+// reports ready, ctx is done, or a non-retryable gRPC status is returned.
+// codes.Unavailable and codes.DeadlineExceeded are treated as retryable,
+// since they're the statuses a plugin returns while it's still starting
+// up; any other status is surfaced immediately as a terminal error.
+func (c *client) ProbeUntilReady(ctx context.Context, interval, timeout time.Duration) error {
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var lastLogged time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		ready, err := c.PluginProbe(ctx)
+		if err == nil && ready {
+			return nil
+		}
+
+		if err != nil {
+			st, ok := status.FromError(err)
+			if !ok || (st.Code() != codes.Unavailable && st.Code() != codes.DeadlineExceeded) {
+				return err
+			}
+
+			if time.Since(lastLogged) >= probeErrLogInterval {
+				c.logger.Warn("plugin not yet responding to probe", "error", err)
+				lastLogged = time.Now()
+			}
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+func newGRPCConn(addr string) (*grpc.ClientConn, error) {
+	return grpc.Dial(addr, grpc.WithInsecure())
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	csipbv1 "github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/protobuf/ptypes/wrappers"
 	fake "github.com/hashicorp/nomad/plugins/csi/testing"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func newTestClient() (*fake.IdentityClient, *fake.ControllerClient, *fake.NodeClient, CSIPlugin) {
@@ -246,6 +249,23 @@ func TestClient_RPC_ControllerGetCapabilities(t *testing.T) {
 				HasListVolumesPublishedNodes: true,
 			},
 		},
+		{
+			Name: "detects expand volume capability",
+			Response: &csipbv1.ControllerGetCapabilitiesResponse{
+				Capabilities: []*csipbv1.ControllerServiceCapability{
+					{
+						Type: &csipbv1.ControllerServiceCapability_Rpc{
+							Rpc: &csipbv1.ControllerServiceCapability_RPC{
+								Type: csipbv1.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+							},
+						},
+					},
+				},
+			},
+			ExpectedResponse: &ControllerCapabilitySet{
+				HasExpandVolume: true,
+			},
+		},
 		{
 			Name: "detects publish capabilities",
 			Response: &csipbv1.ControllerGetCapabilitiesResponse{
@@ -311,7 +331,7 @@ func TestClient_RPC_NodeGetCapabilities(t *testing.T) {
 					{
 						Type: &csipbv1.NodeServiceCapability_Rpc{
 							Rpc: &csipbv1.NodeServiceCapability_RPC{
-								Type: csipbv1.NodeServiceCapability_RPC_EXPAND_VOLUME,
+								Type: csipbv1.NodeServiceCapability_RPC_UNKNOWN,
 							},
 						},
 					},
@@ -319,6 +339,40 @@ func TestClient_RPC_NodeGetCapabilities(t *testing.T) {
 			},
 			ExpectedResponse: &NodeCapabilitySet{},
 		},
+		{
+			Name: "detects get volume stats capability",
+			Response: &csipbv1.NodeGetCapabilitiesResponse{
+				Capabilities: []*csipbv1.NodeServiceCapability{
+					{
+						Type: &csipbv1.NodeServiceCapability_Rpc{
+							Rpc: &csipbv1.NodeServiceCapability_RPC{
+								Type: csipbv1.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+							},
+						},
+					},
+				},
+			},
+			ExpectedResponse: &NodeCapabilitySet{
+				HasGetVolumeStats: true,
+			},
+		},
+		{
+			Name: "detects volume condition capability",
+			Response: &csipbv1.NodeGetCapabilitiesResponse{
+				Capabilities: []*csipbv1.NodeServiceCapability{
+					{
+						Type: &csipbv1.NodeServiceCapability_Rpc{
+							Rpc: &csipbv1.NodeServiceCapability_RPC{
+								Type: csipbv1.NodeServiceCapability_RPC_VOLUME_CONDITION,
+							},
+						},
+					},
+				},
+			},
+			ExpectedResponse: &NodeCapabilitySet{
+				HasVolumeCondition: true,
+			},
+		},
 		{
 			Name: "detects stage volumes capability",
 			Response: &csipbv1.NodeGetCapabilitiesResponse{
@@ -336,6 +390,23 @@ func TestClient_RPC_NodeGetCapabilities(t *testing.T) {
 				HasStageUnstageVolume: true,
 			},
 		},
+		{
+			Name: "detects expand volume capability",
+			Response: &csipbv1.NodeGetCapabilitiesResponse{
+				Capabilities: []*csipbv1.NodeServiceCapability{
+					{
+						Type: &csipbv1.NodeServiceCapability_Rpc{
+							Rpc: &csipbv1.NodeServiceCapability_RPC{
+								Type: csipbv1.NodeServiceCapability_RPC_EXPAND_VOLUME,
+							},
+						},
+					},
+				},
+			},
+			ExpectedResponse: &NodeCapabilitySet{
+				HasExpandVolume: true,
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -399,7 +470,10 @@ func TestClient_RPC_ControllerPublishVolume(t *testing.T) {
 			cc.NextErr = c.ResponseErr
 			cc.NextPublishVolumeResponse = c.Response
 
-			resp, err := client.ControllerPublishVolume(context.TODO(), &ControllerPublishVolumeRequest{})
+			resp, err := client.ControllerPublishVolume(context.TODO(), &ControllerPublishVolumeRequest{
+				VolumeID: "vol-1",
+				NodeID:   "node-1",
+			})
 			if c.ExpectedErr != nil {
 				require.Error(t, c.ExpectedErr, err)
 			}
@@ -409,6 +483,42 @@ func TestClient_RPC_ControllerPublishVolume(t *testing.T) {
 	}
 }
 
+func TestClient_RPC_ControllerPublishVolume_RequiresVolumeAndNodeID(t *testing.T) {
+	_, cc, _, client := newTestClient()
+	defer client.Close()
+
+	cc.NextPublishVolumeResponse = &csipbv1.ControllerPublishVolumeResponse{}
+
+	_, err := client.ControllerPublishVolume(context.TODO(), &ControllerPublishVolumeRequest{NodeID: "node-1"})
+	require.Error(t, err)
+
+	_, err = client.ControllerPublishVolume(context.TODO(), &ControllerPublishVolumeRequest{VolumeID: "vol-1"})
+	require.Error(t, err)
+}
+
+func TestClient_RPC_ControllerPublishVolume_SendsVolumeCapability(t *testing.T) {
+	_, cc, _, client := newTestClient()
+	defer client.Close()
+
+	cc.NextPublishVolumeResponse = &csipbv1.ControllerPublishVolumeResponse{}
+
+	_, err := client.ControllerPublishVolume(context.TODO(), &ControllerPublishVolumeRequest{
+		VolumeID: "vol-1",
+		NodeID:   "node-1",
+		VolumeCapability: &VolumeCapability{
+			AccessType: VolumeAccessTypeMount,
+			AccessMode: VolumeAccessModeSingleNodeReaderOnly,
+		},
+	})
+	require.NoError(t, err)
+
+	require.NotNil(t, cc.LastPublishVolumeRequest.VolumeCapability)
+	require.NotNil(t, cc.LastPublishVolumeRequest.VolumeCapability.GetMount())
+	require.Equal(t,
+		csipbv1.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		cc.LastPublishVolumeRequest.VolumeCapability.GetAccessMode().GetMode())
+}
+
 func TestClient_RPC_NodeStageVolume(t *testing.T) {
 	cases := []struct {
 		Name        string
@@ -446,6 +556,23 @@ func TestClient_RPC_NodeStageVolume(t *testing.T) {
 	}
 }
 
+func TestClient_RPC_NodeStageVolume_SendsVolumeCapability(t *testing.T) {
+	_, _, nc, client := newTestClient()
+	defer client.Close()
+
+	err := client.NodeStageVolume(context.TODO(), "foo", nil, "/foo", &VolumeCapability{
+		AccessType: VolumeAccessTypeBlock,
+		AccessMode: VolumeAccessModeMultiNodeMultiWriter,
+	})
+	require.NoError(t, err)
+
+	require.NotNil(t, nc.LastStageVolumeRequest.VolumeCapability)
+	require.NotNil(t, nc.LastStageVolumeRequest.VolumeCapability.GetBlock())
+	require.Equal(t,
+		csipbv1.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		nc.LastStageVolumeRequest.VolumeCapability.GetAccessMode().GetMode())
+}
+
 func TestClient_RPC_NodeUnstageVolume(t *testing.T) {
 	cases := []struct {
 		Name        string
@@ -482,3 +609,292 @@ func TestClient_RPC_NodeUnstageVolume(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_Subscribe_ReplaysPluginRegistered(t *testing.T) {
+	// EventPluginRegistered fires inside NewClient, before the caller
+	// could possibly have subscribed yet. Exercise the eventer directly
+	// (rather than NewClient, which requires a real gRPC dial) to assert
+	// it's still delivered to a subscriber that joins afterward.
+	_, _, _, plugin := newTestClient()
+	defer plugin.Close()
+
+	c := plugin.(*client)
+	c.emitAndReplay(PluginEvent{Type: EventPluginRegistered, PluginID: "plugin-1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := c.Subscribe(ctx)
+	ev := <-events
+	require.Equal(t, EventPluginRegistered, ev.Type)
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	ic, _, _, client := newTestClient()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := client.Subscribe(ctx)
+
+	ic.NextPluginProbe = &csipbv1.ProbeResponse{Ready: &wrappers.BoolValue{Value: true}}
+	ready, err := client.PluginProbe(context.TODO())
+	require.NoError(t, err)
+	require.True(t, ready)
+
+	ev := <-events
+	require.Equal(t, EventPluginReady, ev.Type)
+}
+
+func TestClient_Subscribe_PluginReadyOnlyOnTransition(t *testing.T) {
+	ic, _, _, client := newTestClient()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := client.Subscribe(ctx)
+
+	ic.NextPluginProbe = &csipbv1.ProbeResponse{Ready: &wrappers.BoolValue{Value: true}}
+	for i := 0; i < 3; i++ {
+		ready, err := client.PluginProbe(context.TODO())
+		require.NoError(t, err)
+		require.True(t, ready)
+	}
+
+	ev := <-events
+	require.Equal(t, EventPluginReady, ev.Type)
+
+	select {
+	case ev := <-events:
+		t.Fatalf("expected no further events, got: %+v", ev)
+	default:
+	}
+}
+
+func TestClient_Subscribe_ControllerPublishVolume(t *testing.T) {
+	_, cc, _, client := newTestClient()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := client.Subscribe(ctx)
+
+	cc.NextPublishVolumeResponse = &csipbv1.ControllerPublishVolumeResponse{}
+	_, err := client.ControllerPublishVolume(context.TODO(), &ControllerPublishVolumeRequest{
+		VolumeID: "vol-1",
+		NodeID:   "node-1",
+	})
+	require.NoError(t, err)
+	require.Equal(t, EventControllerPublishStart, (<-events).Type)
+	require.Equal(t, EventControllerPublishOK, (<-events).Type)
+
+	cc.NextErr = status.Error(codes.Internal, "boom")
+	_, err = client.ControllerPublishVolume(context.TODO(), &ControllerPublishVolumeRequest{
+		VolumeID: "vol-1",
+		NodeID:   "node-1",
+	})
+	require.Error(t, err)
+	require.Equal(t, EventControllerPublishStart, (<-events).Type)
+	require.Equal(t, EventControllerPublishFail, (<-events).Type)
+}
+
+func TestClient_Subscribe_NodeStageAndUnstageVolume(t *testing.T) {
+	_, _, nc, client := newTestClient()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := client.Subscribe(ctx)
+
+	err := client.NodeStageVolume(context.TODO(), "vol-1", nil, "/tmp/staging", &VolumeCapability{})
+	require.NoError(t, err)
+	require.Equal(t, EventNodeStageStart, (<-events).Type)
+	require.Equal(t, EventNodeStageOK, (<-events).Type)
+
+	err = client.NodeUnstageVolume(context.TODO(), "vol-1", "/tmp/staging")
+	require.NoError(t, err)
+	require.Equal(t, EventNodeStageStart, (<-events).Type)
+	require.Equal(t, EventNodeStageOK, (<-events).Type)
+
+	nc.NextErr = status.Error(codes.Internal, "boom")
+	err = client.NodeUnstageVolume(context.TODO(), "vol-1", "/tmp/staging")
+	require.Error(t, err)
+	require.Equal(t, EventNodeStageStart, (<-events).Type)
+	require.Equal(t, EventNodeStageFail, (<-events).Type)
+}
+
+func TestClient_ProbeUntilReady(t *testing.T) {
+	ic, _, _, client := newTestClient()
+	defer client.Close()
+
+	ic.ProbeSequence = []*csipbv1.ProbeResponse{
+		{Ready: &wrappers.BoolValue{Value: false}},
+		{Ready: &wrappers.BoolValue{Value: false}},
+		{Ready: &wrappers.BoolValue{Value: true}},
+	}
+
+	err := client.ProbeUntilReady(context.Background(), time.Millisecond, time.Second)
+	require.NoError(t, err)
+	require.Empty(t, ic.ProbeSequence)
+}
+
+func TestClient_ProbeUntilReady_TerminalError(t *testing.T) {
+	ic, _, _, client := newTestClient()
+	defer client.Close()
+
+	ic.NextErr = status.Error(codes.InvalidArgument, "bad request")
+
+	err := client.ProbeUntilReady(context.Background(), time.Millisecond, time.Second)
+	require.Error(t, err)
+}
+
+func TestClient_RPC_NodeGetVolumeStats(t *testing.T) {
+	cases := []struct {
+		Name             string
+		ResponseErr      error
+		Response         *csipbv1.NodeGetVolumeStatsResponse
+		ExpectedResponse *VolumeStats
+		ExpectedErr      error
+	}{
+		{
+			Name:        "handles underlying grpc errors",
+			ResponseErr: fmt.Errorf("some grpc error"),
+			ExpectedErr: fmt.Errorf("some grpc error"),
+		},
+		{
+			Name: "returns usage and condition",
+			Response: &csipbv1.NodeGetVolumeStatsResponse{
+				Usage: []*csipbv1.VolumeUsage{
+					{
+						Unit:      csipbv1.VolumeUsage_BYTES,
+						Used:      100,
+						Available: 900,
+						Total:     1000,
+					},
+				},
+				VolumeCondition: &csipbv1.VolumeCondition{
+					Abnormal: true,
+					Message:  "filesystem is corrupt",
+				},
+			},
+			ExpectedResponse: &VolumeStats{
+				Bytes: &VolumeUsage{
+					Used:      100,
+					Available: 900,
+					Total:     1000,
+				},
+				Condition: &VolumeCondition{
+					Abnormal: true,
+					Message:  "filesystem is corrupt",
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, _, nc, client := newTestClient()
+			defer client.Close()
+
+			nc.NextErr = c.ResponseErr
+			nc.NextVolumeStatsResponse = c.Response
+
+			resp, err := client.NodeGetVolumeStats(context.TODO(), "foo", "/foo")
+			if c.ExpectedErr != nil {
+				require.Error(t, c.ExpectedErr, err)
+			}
+
+			require.Equal(t, c.ExpectedResponse, resp)
+		})
+	}
+}
+
+func TestClient_RPC_ControllerExpandVolume(t *testing.T) {
+	cases := []struct {
+		Name             string
+		ResponseErr      error
+		Response         *csipbv1.ControllerExpandVolumeResponse
+		ExpectedResponse *ControllerExpandVolumeResponse
+		ExpectedErr      error
+	}{
+		{
+			Name:        "handles underlying grpc errors",
+			ResponseErr: fmt.Errorf("some grpc error"),
+			ExpectedErr: fmt.Errorf("some grpc error"),
+		},
+		{
+			Name: "returns the new capacity and node expansion requirement",
+			Response: &csipbv1.ControllerExpandVolumeResponse{
+				CapacityBytes:         1000000000,
+				NodeExpansionRequired: true,
+			},
+			ExpectedResponse: &ControllerExpandVolumeResponse{
+				CapacityBytes:         1000000000,
+				NodeExpansionRequired: true,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, cc, _, client := newTestClient()
+			defer client.Close()
+
+			cc.NextErr = c.ResponseErr
+			cc.NextExpandVolumeResponse = c.Response
+
+			resp, err := client.ControllerExpandVolume(context.TODO(), &ControllerExpandVolumeRequest{VolumeID: "foo"})
+			if c.ExpectedErr != nil {
+				require.Error(t, c.ExpectedErr, err)
+			}
+
+			require.Equal(t, c.ExpectedResponse, resp)
+		})
+	}
+}
+
+func TestClient_RPC_NodeExpandVolume(t *testing.T) {
+	cases := []struct {
+		Name             string
+		ResponseErr      error
+		Response         *csipbv1.NodeExpandVolumeResponse
+		ExpectedResponse *NodeExpandVolumeResponse
+		ExpectedErr      error
+	}{
+		{
+			Name:        "handles underlying grpc errors",
+			ResponseErr: fmt.Errorf("some grpc error"),
+			ExpectedErr: fmt.Errorf("some grpc error"),
+		},
+		{
+			Name: "returns the new capacity",
+			Response: &csipbv1.NodeExpandVolumeResponse{
+				CapacityBytes: 1000000000,
+			},
+			ExpectedResponse: &NodeExpandVolumeResponse{
+				CapacityBytes: 1000000000,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, _, nc, client := newTestClient()
+			defer client.Close()
+
+			nc.NextErr = c.ResponseErr
+			nc.NextExpandVolumeResponse = c.Response
+
+			resp, err := client.NodeExpandVolume(context.TODO(), &NodeExpandVolumeRequest{VolumeID: "foo", VolumePath: "/foo"})
+			if c.ExpectedErr != nil {
+				require.Error(t, c.ExpectedErr, err)
+			}
+
+			require.Equal(t, c.ExpectedResponse, resp)
+		})
+	}
+}
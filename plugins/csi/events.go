@@ -0,0 +1,133 @@
+package csi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// PluginEventType identifies the kind of lifecycle transition a PluginEvent
+// describes.
+type PluginEventType string
+
+const (
+	// EventPluginRegistered fires once, when a client is constructed for a
+	// plugin (i.e. when Nomad registers it). It fires before any caller
+	// could have subscribed, so it's replayed to every subscriber's first
+	// Subscribe call instead of only going to subscribers active at the
+	// time.
+	EventPluginRegistered       PluginEventType = "PluginRegistered"
+	EventPluginProbeFailed      PluginEventType = "PluginProbeFailed"
+	EventPluginReady            PluginEventType = "PluginReady"
+	EventControllerPublishStart PluginEventType = "ControllerPublishStarted"
+	EventControllerPublishOK    PluginEventType = "ControllerPublishCompleted"
+	EventControllerPublishFail  PluginEventType = "ControllerPublishFailed"
+	// EventNodeStage{Start,OK,Fail} cover both NodeStageVolume and
+	// NodeUnstageVolume, since they bracket the same staging directory
+	// lifecycle on the node.
+	EventNodeStageStart PluginEventType = "NodeStageStarted"
+	EventNodeStageOK    PluginEventType = "NodeStageCompleted"
+	EventNodeStageFail  PluginEventType = "NodeStageFailed"
+	// EventPluginUnregistered fires once, when a client's connection to its
+	// plugin is torn down (i.e. when Nomad deregisters it).
+	EventPluginUnregistered PluginEventType = "PluginUnregistered"
+)
+
+// PluginEvent describes a single observed transition in a CSI plugin's
+// lifecycle. It is intentionally flat so that it could be serialized onto
+// an event stream without extra translation, but nothing currently
+// subscribes it to `nomad event stream` - for now this is only consumable
+// in-process via eventer.Subscribe.
+type PluginEvent struct {
+	Type PluginEventType
+
+	PluginID string
+	VolumeID string
+	NodeID   string
+
+	// Duration is populated for events that bracket an RPC call (the
+	// ControllerPublish* and NodeStage* *Completed and *Failed variants).
+	// PluginProbeFailed carries no Duration.
+	Duration time.Duration
+
+	// Code is the gRPC status code associated with the event, if any.
+	Code codes.Code
+
+	Err error
+
+	Timestamp time.Time
+}
+
+// eventer is embedded in client to provide a subscribable stream of
+// PluginEvents without requiring callers to poll plugin state.
+type eventer struct {
+	mu   sync.Mutex
+	subs map[int]chan PluginEvent
+	next int
+
+	// replay, when set, is delivered to every new subscriber as soon as
+	// it calls Subscribe. It exists so that an event emitted before any
+	// subscriber could possibly have existed yet - EventPluginRegistered
+	// fires inside NewClient, before the constructed client is ever
+	// handed back to a caller - isn't silently dropped by emit's
+	// no-subscribers case.
+	replay *PluginEvent
+}
+
+// Subscribe returns a channel of PluginEvents for this plugin. The channel
+// is closed when ctx is canceled. Subscribers that fail to keep up with the
+// event rate will have events dropped rather than blocking emission.
+func (e *eventer) Subscribe(ctx context.Context) <-chan PluginEvent {
+	e.mu.Lock()
+	if e.subs == nil {
+		e.subs = make(map[int]chan PluginEvent)
+	}
+	id := e.next
+	e.next++
+	ch := make(chan PluginEvent, 16)
+	e.subs[id] = ch
+	if e.replay != nil {
+		ch <- *e.replay
+	}
+	e.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		e.mu.Lock()
+		delete(e.subs, id)
+		close(ch)
+		e.mu.Unlock()
+	}()
+
+	return ch
+}
+
+// emit fans an event out to all current subscribers without blocking on a
+// slow or absent reader.
+func (e *eventer) emit(ev PluginEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// emitAndReplay is like emit, but also remembers ev so that it can be
+// replayed to subscribers that join after it fires.
+func (e *eventer) emitAndReplay(ev PluginEvent) {
+	e.mu.Lock()
+	e.replay = &ev
+	for _, ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	e.mu.Unlock()
+}
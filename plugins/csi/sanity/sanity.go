@@ -0,0 +1,209 @@
+// Package sanity implements a csi-sanity-style conformance suite that
+// drives a real CSI plugin through the lifecycle Nomad itself exercises -
+// create, publish, stage, mount, unmount, unstage, unpublish, delete -
+// asserting the idempotency and error-code guarantees the CSI spec
+// requires. It is a standalone library today: there is no
+// "nomad operator csi sanity" command yet, so operators wanting to use it
+// must call Suite.Run from their own Go program against a dialed
+// csi.CSIPlugin.
+package sanity
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/nomad/plugins/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Config controls how Suite exercises a plugin.
+type Config struct {
+	// Plugin is the client under test. It's typically dialed against the
+	// plugin's CSI socket with csi.NewClient.
+	Plugin csi.CSIPlugin
+
+	// VolumeName is used as the name for the volume this suite
+	// provisions and tears down.
+	VolumeName string
+
+	// NodeID identifies the node the suite publishes the volume to.
+	NodeID string
+
+	StagingPath string
+	TargetPath  string
+}
+
+// Suite runs the CSI conformance sequence against a single plugin.
+type Suite struct {
+	cfg *Config
+
+	volumeID string
+}
+
+// New returns a Suite that will exercise cfg.Plugin when Run.
+func New(cfg *Config) *Suite {
+	return &Suite{cfg: cfg}
+}
+
+// step names one stage of the conformance sequence, in the order the CSI
+// spec expects a CO to drive them.
+type step struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Run executes the full conformance sequence in order and returns the
+// first violation encountered, wrapped with the step name it occurred in.
+func (s *Suite) Run(ctx context.Context) error {
+	steps := []step{
+		{"GetPluginInfo", s.testGetPluginInfo},
+		{"GetPluginCapabilities", s.testGetPluginCapabilities},
+		{"ControllerGetCapabilities", s.testControllerGetCapabilities},
+		{"CreateVolume", s.testCreateVolume},
+		{"ControllerPublishVolume", s.testControllerPublishVolume},
+		{"NodeStageVolume", s.testNodeStageVolume},
+		{"NodePublishVolume", s.testNodePublishVolume},
+		{"NodeUnpublishVolume", s.testNodeUnpublishVolume},
+		{"NodeUnstageVolume", s.testNodeUnstageVolume},
+		{"ControllerUnpublishVolume", s.testControllerUnpublishVolume},
+		{"DeleteVolume", s.testDeleteVolume},
+	}
+
+	for _, st := range steps {
+		if err := st.fn(ctx); err != nil {
+			return fmt.Errorf("%s: %w", st.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Suite) testGetPluginInfo(ctx context.Context) error {
+	name, err := s.cfg.Plugin.PluginGetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("expected a non-empty plugin name")
+	}
+	return nil
+}
+
+func (s *Suite) testGetPluginCapabilities(ctx context.Context) error {
+	_, err := s.cfg.Plugin.PluginGetCapabilities(ctx)
+	return err
+}
+
+func (s *Suite) testControllerGetCapabilities(ctx context.Context) error {
+	_, err := s.cfg.Plugin.ControllerGetCapabilities(ctx)
+	return err
+}
+
+func (s *Suite) testCreateVolume(ctx context.Context) error {
+	if s.cfg.VolumeName == "" {
+		return fmt.Errorf("sanity config missing VolumeName")
+	}
+
+	req := &csi.CreateVolumeRequest{
+		Name: s.cfg.VolumeName,
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 1 << 20, // 1MiB, the CSI spec's minimum reasonable size
+		},
+	}
+
+	resp, err := s.cfg.Plugin.CreateVolume(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.VolumeID == "" {
+		return fmt.Errorf("expected a non-empty VolumeID")
+	}
+	s.volumeID = resp.VolumeID
+
+	// CreateVolume must be idempotent: issuing it again with the same
+	// parameters should succeed and return the same volume, not
+	// AlreadyExists.
+	resp2, err := s.cfg.Plugin.CreateVolume(ctx, req)
+	if err != nil {
+		return fmt.Errorf("expected idempotent CreateVolume to succeed, got: %w", err)
+	}
+	if resp2.VolumeID != s.volumeID {
+		return fmt.Errorf("expected idempotent CreateVolume to return VolumeID %q, got %q", s.volumeID, resp2.VolumeID)
+	}
+
+	// A conflicting create (same name, different size) must fail with
+	// AlreadyExists.
+	conflicting := *req
+	conflicting.CapacityRange = &csi.CapacityRange{RequiredBytes: req.CapacityRange.RequiredBytes * 2}
+	if _, err := s.cfg.Plugin.CreateVolume(ctx, &conflicting); status.Code(err) != codes.AlreadyExists {
+		return fmt.Errorf("expected AlreadyExists for a conflicting CreateVolume, got: %v", err)
+	}
+
+	return nil
+}
+
+func (s *Suite) testControllerPublishVolume(ctx context.Context) error {
+	if _, err := s.cfg.Plugin.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{}); status.Code(err) != codes.InvalidArgument {
+		return fmt.Errorf("expected InvalidArgument when VolumeID is missing, got: %v", err)
+	}
+
+	if _, err := s.cfg.Plugin.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeID: "nonexistent-volume-id",
+		NodeID:   s.cfg.NodeID,
+	}); status.Code(err) != codes.NotFound {
+		return fmt.Errorf("expected NotFound when publishing a nonexistent volume, got: %v", err)
+	}
+
+	_, err := s.cfg.Plugin.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeID: s.volumeID,
+		NodeID:   s.cfg.NodeID,
+	})
+	return err
+}
+
+func (s *Suite) testNodeStageVolume(ctx context.Context) error {
+	// The Nomad client wrapper validates VolumeID locally before issuing
+	// the RPC, so this case never reaches the plugin and can't be
+	// expected to carry a gRPC status code - just assert it's rejected.
+	if err := s.cfg.Plugin.NodeStageVolume(ctx, "", nil, s.cfg.StagingPath, &csi.VolumeCapability{}); err == nil {
+		return fmt.Errorf("expected an error when VolumeID is missing")
+	}
+
+	return s.cfg.Plugin.NodeStageVolume(ctx, s.volumeID, nil, s.cfg.StagingPath, &csi.VolumeCapability{})
+}
+
+func (s *Suite) testNodePublishVolume(ctx context.Context) error {
+	return s.cfg.Plugin.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+		VolumeID:          s.volumeID,
+		StagingTargetPath: s.cfg.StagingPath,
+		TargetPath:        s.cfg.TargetPath,
+	})
+}
+
+func (s *Suite) testNodeUnpublishVolume(ctx context.Context) error {
+	return s.cfg.Plugin.NodeUnpublishVolume(ctx, s.volumeID, s.cfg.TargetPath)
+}
+
+func (s *Suite) testNodeUnstageVolume(ctx context.Context) error {
+	return s.cfg.Plugin.NodeUnstageVolume(ctx, s.volumeID, s.cfg.StagingPath)
+}
+
+func (s *Suite) testControllerUnpublishVolume(ctx context.Context) error {
+	return s.cfg.Plugin.ControllerUnpublishVolume(ctx, s.volumeID, s.cfg.NodeID)
+}
+
+func (s *Suite) testDeleteVolume(ctx context.Context) error {
+	// Per spec, DeleteVolume on a volume that doesn't exist must be
+	// treated as a successful no-op, not an error.
+	if err := s.cfg.Plugin.DeleteVolume(ctx, "nonexistent-volume-id"); err != nil {
+		return fmt.Errorf("expected DeleteVolume of a nonexistent volume to be a no-op, got: %w", err)
+	}
+
+	if err := s.cfg.Plugin.DeleteVolume(ctx, s.volumeID); err != nil {
+		return err
+	}
+
+	// DeleteVolume must be idempotent.
+	return s.cfg.Plugin.DeleteVolume(ctx, s.volumeID)
+}
@@ -0,0 +1,89 @@
+package sanity
+
+import (
+	"context"
+	"testing"
+
+	csipbv1 "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/hashicorp/nomad/plugins/csi"
+	fake "github.com/hashicorp/nomad/plugins/csi/testing"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakePlugin is a minimal, well-behaved csi.CSIPlugin used to exercise
+// Suite.Run without a real plugin socket. It embeds a real csi.CSIPlugin
+// backed by plugins/csi/testing fakes so that RPCs this suite doesn't need
+// specific idempotency/conflict behavior for (e.g. NodeStageVolume's
+// local VolumeID validation) are exercised through the actual client code,
+// not reimplemented here.
+type fakePlugin struct {
+	csi.CSIPlugin
+
+	volumes map[string]int64 // name -> RequiredBytes of the volume that was created
+}
+
+func newFakePlugin() *fakePlugin {
+	ic := fake.NewIdentityClient()
+	ic.NextPluginInfo = &csipbv1.GetPluginInfoResponse{Name: "com.hashicorp.sanity-fake"}
+	ic.NextPluginCapabilities = &csipbv1.GetPluginCapabilitiesResponse{}
+
+	cc := fake.NewControllerClient()
+	cc.NextCapabilitiesResponse = &csipbv1.ControllerGetCapabilitiesResponse{}
+
+	nc := fake.NewNodeClient()
+
+	return &fakePlugin{
+		CSIPlugin: csi.NewTestClient(ic, cc, nc),
+		volumes:   map[string]int64{},
+	}
+}
+
+func (f *fakePlugin) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	id := "vol-" + req.Name
+	var requiredBytes int64
+	if req.CapacityRange != nil {
+		requiredBytes = req.CapacityRange.RequiredBytes
+	}
+
+	if existing, ok := f.volumes[req.Name]; ok {
+		if existing != requiredBytes {
+			return nil, status.Error(codes.AlreadyExists, "volume exists with different parameters")
+		}
+		return &csi.CreateVolumeResponse{VolumeID: id}, nil
+	}
+
+	f.volumes[req.Name] = requiredBytes
+	return &csi.CreateVolumeResponse{VolumeID: id}, nil
+}
+
+func (f *fakePlugin) DeleteVolume(ctx context.Context, volumeID string) error {
+	return nil
+}
+
+func (f *fakePlugin) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	if req.VolumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume_id")
+	}
+	if req.VolumeID == "nonexistent-volume-id" {
+		return nil, status.Error(codes.NotFound, "no such volume")
+	}
+	return &csi.ControllerPublishVolumeResponse{}, nil
+}
+
+func (f *fakePlugin) ControllerUnpublishVolume(ctx context.Context, volumeID, nodeID string) error {
+	return nil
+}
+
+func TestSuite_Run(t *testing.T) {
+	suite := New(&Config{
+		Plugin:      newFakePlugin(),
+		VolumeName:  "sanity-test-volume",
+		NodeID:      "node-1",
+		StagingPath: "/tmp/sanity/staging",
+		TargetPath:  "/tmp/sanity/target",
+	})
+
+	require.NoError(t, suite.Run(context.Background()))
+}
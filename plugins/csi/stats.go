@@ -0,0 +1,74 @@
+package csi
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// defaultVolumeStatsPollInterval is the fallback interval VolumeStatsPoller
+// uses when the caller doesn't specify one.
+const defaultVolumeStatsPollInterval = 30 * time.Second
+
+// VolumeStatsPoller periodically calls NodeGetVolumeStats for a single
+// published volume and hands the result to a callback, so that callers
+// (the client node's CSI volume manager, a metrics exporter, an HTTP
+// endpoint) can observe capacity usage and health without each
+// maintaining their own polling loop. Nothing in Nomad constructs one of
+// these yet - it's a primitive for those future callers to use, not
+// itself wired into a client node, an HTTP endpoint, or a Prometheus
+// gauge.
+type VolumeStatsPoller struct {
+	plugin     CSIPlugin
+	volumeID   string
+	volumePath string
+	interval   time.Duration
+	logger     hclog.Logger
+
+	onStats func(*VolumeStats)
+}
+
+// NewVolumeStatsPoller constructs a poller for a single volume. interval
+// defaults to 30s when <= 0. onStats is invoked from the polling
+// goroutine on every successful NodeGetVolumeStats call; it must not
+// block.
+func NewVolumeStatsPoller(plugin CSIPlugin, volumeID, volumePath string, interval time.Duration, logger hclog.Logger, onStats func(*VolumeStats)) *VolumeStatsPoller {
+	if interval <= 0 {
+		interval = defaultVolumeStatsPollInterval
+	}
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	return &VolumeStatsPoller{
+		plugin:     plugin,
+		volumeID:   volumeID,
+		volumePath: volumePath,
+		interval:   interval,
+		logger:     logger,
+		onStats:    onStats,
+	}
+}
+
+// Run blocks, polling until ctx is canceled. Errors from individual polls
+// are logged and do not stop the loop, since a single failed stat call
+// shouldn't take down monitoring for the rest of the volume's lifetime.
+func (p *VolumeStatsPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats, err := p.plugin.NodeGetVolumeStats(ctx, p.volumeID, p.volumePath)
+			if err != nil {
+				p.logger.Warn("failed to poll CSI volume stats", "volume_id", p.volumeID, "error", err)
+				continue
+			}
+			p.onStats(stats)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package csi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	csipbv1 "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumeStatsPoller_Run(t *testing.T) {
+	_, _, nc, client := newTestClient()
+	defer client.Close()
+
+	nc.NextVolumeStatsResponse = &csipbv1.NodeGetVolumeStatsResponse{
+		Usage: []*csipbv1.VolumeUsage{
+			{Unit: csipbv1.VolumeUsage_BYTES, Total: 100, Used: 10, Available: 90},
+		},
+	}
+
+	var mu sync.Mutex
+	var gotStats []*VolumeStats
+	onStats := func(s *VolumeStats) {
+		mu.Lock()
+		defer mu.Unlock()
+		gotStats = append(gotStats, s)
+	}
+
+	poller := NewVolumeStatsPoller(client, "vol-1", "/tmp/vol-1", time.Millisecond, nil, onStats)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		poller.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(gotStats) > 0
+	}, time.Second, time.Millisecond, "expected onStats to fire at least once")
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return after context cancellation")
+	}
+}
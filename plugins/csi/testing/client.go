@@ -0,0 +1,200 @@
+// Package testing provides fake CSI gRPC clients for exercising the
+// plugins/csi client code without a real CSI plugin socket.
+package testing
+
+import (
+	"context"
+
+	csipbv1 "github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+)
+
+// IdentityClient is a mock implementation of the csi.IdentityClient interface
+// for use in tests.
+type IdentityClient struct {
+	NextErr                error
+	NextPluginInfo         *csipbv1.GetPluginInfoResponse
+	NextPluginCapabilities *csipbv1.GetPluginCapabilitiesResponse
+	NextPluginProbe        *csipbv1.ProbeResponse
+
+	// ProbeSequence, when non-empty, is consumed one response per Probe
+	// call (FIFO) so tests can assert retry behavior across a sequence
+	// of not-ready -> ready responses. It takes precedence over
+	// NextPluginProbe while entries remain.
+	ProbeSequence []*csipbv1.ProbeResponse
+}
+
+func NewIdentityClient() *IdentityClient {
+	return &IdentityClient{}
+}
+
+func (f *IdentityClient) GetPluginInfo(ctx context.Context, in *csipbv1.GetPluginInfoRequest, opts ...grpc.CallOption) (*csipbv1.GetPluginInfoResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextPluginInfo, nil
+}
+
+func (f *IdentityClient) GetPluginCapabilities(ctx context.Context, in *csipbv1.GetPluginCapabilitiesRequest, opts ...grpc.CallOption) (*csipbv1.GetPluginCapabilitiesResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextPluginCapabilities, nil
+}
+
+func (f *IdentityClient) Probe(ctx context.Context, in *csipbv1.ProbeRequest, opts ...grpc.CallOption) (*csipbv1.ProbeResponse, error) {
+	if len(f.ProbeSequence) > 0 {
+		resp := f.ProbeSequence[0]
+		f.ProbeSequence = f.ProbeSequence[1:]
+		return resp, nil
+	}
+
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextPluginProbe, nil
+}
+
+// ControllerClient is a mock implementation of the csi.ControllerClient
+// interface for use in tests.
+type ControllerClient struct {
+	NextErr                   error
+	NextCapabilitiesResponse  *csipbv1.ControllerGetCapabilitiesResponse
+	NextPublishVolumeResponse *csipbv1.ControllerPublishVolumeResponse
+	NextExpandVolumeResponse  *csipbv1.ControllerExpandVolumeResponse
+
+	// LastPublishVolumeRequest captures the request passed to the most
+	// recent ControllerPublishVolume call, so tests can assert on what
+	// the client actually put on the wire.
+	LastPublishVolumeRequest *csipbv1.ControllerPublishVolumeRequest
+}
+
+func NewControllerClient() *ControllerClient {
+	return &ControllerClient{}
+}
+
+func (f *ControllerClient) ControllerGetCapabilities(ctx context.Context, in *csipbv1.ControllerGetCapabilitiesRequest, opts ...grpc.CallOption) (*csipbv1.ControllerGetCapabilitiesResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextCapabilitiesResponse, nil
+}
+
+func (f *ControllerClient) ControllerPublishVolume(ctx context.Context, in *csipbv1.ControllerPublishVolumeRequest, opts ...grpc.CallOption) (*csipbv1.ControllerPublishVolumeResponse, error) {
+	f.LastPublishVolumeRequest = in
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextPublishVolumeResponse, nil
+}
+
+func (f *ControllerClient) ControllerExpandVolume(ctx context.Context, in *csipbv1.ControllerExpandVolumeRequest, opts ...grpc.CallOption) (*csipbv1.ControllerExpandVolumeResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextExpandVolumeResponse, nil
+}
+
+func (f *ControllerClient) ControllerUnpublishVolume(ctx context.Context, in *csipbv1.ControllerUnpublishVolumeRequest, opts ...grpc.CallOption) (*csipbv1.ControllerUnpublishVolumeResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) CreateVolume(ctx context.Context, in *csipbv1.CreateVolumeRequest, opts ...grpc.CallOption) (*csipbv1.CreateVolumeResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) DeleteVolume(ctx context.Context, in *csipbv1.DeleteVolumeRequest, opts ...grpc.CallOption) (*csipbv1.DeleteVolumeResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) ListVolumes(ctx context.Context, in *csipbv1.ListVolumesRequest, opts ...grpc.CallOption) (*csipbv1.ListVolumesResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) GetCapacity(ctx context.Context, in *csipbv1.GetCapacityRequest, opts ...grpc.CallOption) (*csipbv1.GetCapacityResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) CreateSnapshot(ctx context.Context, in *csipbv1.CreateSnapshotRequest, opts ...grpc.CallOption) (*csipbv1.CreateSnapshotResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) DeleteSnapshot(ctx context.Context, in *csipbv1.DeleteSnapshotRequest, opts ...grpc.CallOption) (*csipbv1.DeleteSnapshotResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) ListSnapshots(ctx context.Context, in *csipbv1.ListSnapshotsRequest, opts ...grpc.CallOption) (*csipbv1.ListSnapshotsResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *ControllerClient) ValidateVolumeCapabilities(ctx context.Context, in *csipbv1.ValidateVolumeCapabilitiesRequest, opts ...grpc.CallOption) (*csipbv1.ValidateVolumeCapabilitiesResponse, error) {
+	return nil, f.NextErr
+}
+
+// NodeClient is a mock implementation of the csi.NodeClient interface for
+// use in tests.
+type NodeClient struct {
+	NextErr                   error
+	NextCapabilitiesResponse  *csipbv1.NodeGetCapabilitiesResponse
+	NextStageVolumeResponse   *csipbv1.NodeStageVolumeResponse
+	NextUnstageVolumeResponse *csipbv1.NodeUnstageVolumeResponse
+	NextExpandVolumeResponse  *csipbv1.NodeExpandVolumeResponse
+	NextVolumeStatsResponse   *csipbv1.NodeGetVolumeStatsResponse
+
+	// LastStageVolumeRequest captures the request passed to the most
+	// recent NodeStageVolume call, so tests can assert on what the
+	// client actually put on the wire.
+	LastStageVolumeRequest *csipbv1.NodeStageVolumeRequest
+}
+
+func NewNodeClient() *NodeClient {
+	return &NodeClient{}
+}
+
+func (f *NodeClient) NodeGetCapabilities(ctx context.Context, in *csipbv1.NodeGetCapabilitiesRequest, opts ...grpc.CallOption) (*csipbv1.NodeGetCapabilitiesResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextCapabilitiesResponse, nil
+}
+
+func (f *NodeClient) NodeStageVolume(ctx context.Context, in *csipbv1.NodeStageVolumeRequest, opts ...grpc.CallOption) (*csipbv1.NodeStageVolumeResponse, error) {
+	f.LastStageVolumeRequest = in
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextStageVolumeResponse, nil
+}
+
+func (f *NodeClient) NodeUnstageVolume(ctx context.Context, in *csipbv1.NodeUnstageVolumeRequest, opts ...grpc.CallOption) (*csipbv1.NodeUnstageVolumeResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextUnstageVolumeResponse, nil
+}
+
+func (f *NodeClient) NodeExpandVolume(ctx context.Context, in *csipbv1.NodeExpandVolumeRequest, opts ...grpc.CallOption) (*csipbv1.NodeExpandVolumeResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextExpandVolumeResponse, nil
+}
+
+func (f *NodeClient) NodeGetInfo(ctx context.Context, in *csipbv1.NodeGetInfoRequest, opts ...grpc.CallOption) (*csipbv1.NodeGetInfoResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *NodeClient) NodePublishVolume(ctx context.Context, in *csipbv1.NodePublishVolumeRequest, opts ...grpc.CallOption) (*csipbv1.NodePublishVolumeResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *NodeClient) NodeUnpublishVolume(ctx context.Context, in *csipbv1.NodeUnpublishVolumeRequest, opts ...grpc.CallOption) (*csipbv1.NodeUnpublishVolumeResponse, error) {
+	return nil, f.NextErr
+}
+
+func (f *NodeClient) NodeGetVolumeStats(ctx context.Context, in *csipbv1.NodeGetVolumeStatsRequest, opts ...grpc.CallOption) (*csipbv1.NodeGetVolumeStatsResponse, error) {
+	if f.NextErr != nil {
+		return nil, f.NextErr
+	}
+	return f.NextVolumeStatsResponse, nil
+}